@@ -3,25 +3,63 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"github.com/SENAmylove/Dispatcher/sinks"
 	"github.com/fsnotify/fsnotify"
 	"github.com/kardianos/service"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
+// onExistsPolicy controls what dispatch does when the destination object
+// name is already taken.
+type onExistsPolicy string
+
+const (
+	onExistsSkip      onExistsPolicy = "skip"
+	onExistsOverwrite onExistsPolicy = "overwrite"
+	onExistsRename    onExistsPolicy = "rename"
+)
+
 type thread struct {
-	Source      string `json:"source"`
+	Source string `json:"source"`
+	// Destination is a URL whose scheme selects the sinks implementation
+	// that receives dispatched files, e.g. "file:///var/data",
+	// "s3://bucket/prefix", "sftp://user@host/path" or "https://host/upload".
+	// A bare local path is also accepted and treated as file://.
 	Destination string `json:"destination"`
+	Verify      bool   `json:"verify"`
+	OnExists    string `json:"on_exists"`
+
+	// WorkersPerThread is how many goroutines concurrently dispatch files
+	// for this thread. Defaults to 1.
+	WorkersPerThread int `json:"workers_per_thread"`
+	// MaxAttempts is how many dispatch attempts in total a job gets before
+	// it is written to the dead-letter directory. Defaults to 5.
+	MaxAttempts int `json:"max_attempts"`
+	// StabilityPeriod is how long a file's size and mtime must stay
+	// unchanged before it is considered safe to dispatch. Defaults to
+	// "500ms".
+	StabilityPeriod string `json:"stability_period"`
+	// JobTimeout, if set, is the wall-clock time a job is allowed to spend
+	// retrying before it is dead-lettered regardless of MaxAttempts.
+	JobTimeout string `json:"job_timeout"`
 }
 
 type config struct {
-	Threads []thread `json:"threads"`
+	Threads      []thread `json:"threads"`
+	StartupScan  bool     `json:"startup_scan"`
+	ScanInterval string   `json:"scan_interval"`
 }
 
 func recursiveAdd(path string, watcher *fsnotify.Watcher) error {
@@ -36,6 +74,29 @@ func recursiveAdd(path string, watcher *fsnotify.Watcher) error {
 	return nil
 }
 
+// recursiveRemove removes watches for path and every subdirectory under it,
+// undoing a prior recursiveAdd. Unlike recursiveAdd it tolerates path no
+// longer existing on disk (the source directory itself may have been removed
+// along with the thread), since there is then nothing left to walk and
+// nothing left to unwatch.
+func recursiveRemove(path string, watcher *fsnotify.Watcher) error {
+	if err := filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsDir() {
+			return watcher.Remove(path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
 func checkIsDir(path string) (bool, error) {
 	fInfo, err := os.Stat(path)
 	if err != nil {
@@ -74,7 +135,6 @@ func loadConfig(path string) (*config, error) {
 
 	for i := 0; i < len(cf.Threads); i++ {
 		cf.Threads[i].Source = filepath.ToSlash(cf.Threads[i].Source)
-		cf.Threads[i].Destination = filepath.ToSlash(cf.Threads[i].Destination)
 
 		isDir, err := checkIsDir(cf.Threads[i].Source)
 		if err != nil {
@@ -84,64 +144,368 @@ func loadConfig(path string) (*config, error) {
 			return nil, errors.New("Specified path:" + cf.Threads[i].Source + " is not a dir.")
 		}
 
-		isDir, err = checkIsDir(cf.Threads[i].Destination)
-		if err != nil {
-			return nil, err
+		// Validate only checks that the destination parses and carries its
+		// scheme's required fields (and, for a local path, that the
+		// directory exists); it never dials out, so a transiently
+		// unreachable or not-yet-authenticated destination does not stop the
+		// service from starting. The real sink is created lazily on first
+		// dispatch via sinkFor.
+		if err := sinks.Validate(cf.Threads[i].Destination); err != nil {
+			return nil, fmt.Errorf("thread %d: invalid destination %q: %w", i, cf.Threads[i].Destination, err)
 		}
-		if !isDir {
-			return nil, errors.New("Specified path:" + cf.Threads[i].Destination + " is not a dir.")
+
+		if cf.Threads[i].Verify {
+			if err := sinks.ValidateVerify(cf.Threads[i].Destination); err != nil {
+				return nil, fmt.Errorf("thread %d: %w", i, err)
+			}
 		}
 	}
 
 	return cf, nil
 }
 
-func copyFile(from string, to string) error {
-	exist, err := checkExistence(to)
-	if err != nil {
-		logger.Errorf("Cannot check the destination folder existence: %s", to)
-		return err
-	}
-	if !exist {
-		logger.Warningf("Destination folder %s does not exist, it would be created.", to)
-		return err
+// nextSinkRenameCandidate returns the first "name-N.ext" object name not yet
+// present on sink, used by the "rename" on_exists policy.
+func nextSinkRenameCandidate(sink sinks.Sink, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := name[:len(name)-len(ext)]
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		exist, err := sink.Exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exist {
+			return candidate, nil
+		}
 	}
+}
 
-	toFileName := filepath.Join(to, filepath.Base(from))
-	exist, err = checkExistence(toFileName)
+// dispatch streams from into sink under its base name. If verify is true,
+// sink is asked to confirm the object's digest before it is atomically
+// promoted to its final name, so a corrupt write is discarded rather than
+// ever becoming visible to consumers. onExists controls what happens when
+// the final destination name is already taken.
+func dispatch(from string, sink sinks.Sink, verify bool, onExists onExistsPolicy) error {
+	name := filepath.Base(from)
+
+	exist, err := sink.Exists(name)
 	if err != nil {
-		logger.Errorf("Cannot check the destination file existence: %s", toFileName)
+		logger.Errorf("Cannot check destination existence for %s: %s", name, err)
 		return err
 	}
 	if exist {
-		logger.Warningf("The destination file %s already exists.", toFileName)
-		return nil
+		switch onExists {
+		case onExistsOverwrite:
+			logger.Warningf("The destination object %s already exists, it will be overwritten.", name)
+		case onExistsRename:
+			name, err = nextSinkRenameCandidate(sink, name)
+			if err != nil {
+				logger.Errorf("Cannot find a free name for %s: %s", name, err)
+				return err
+			}
+			logger.Warningf("The destination object already exists, renaming to %s.", name)
+		default:
+			logger.Warningf("The destination object %s already exists.", name)
+			return nil
+		}
 	}
 
 	source, err := os.Open(from)
 	if err != nil {
-		logger.Errorf("Cannot open source file %s.", source)
+		logger.Errorf("Cannot open source file %s.", from)
 		return err
 	}
 	defer source.Close()
 
-	destination, err := os.Create(toFileName)
+	info, err := source.Stat()
 	if err != nil {
-		logger.Errorf("Cannot create destination file %s.", destination)
+		logger.Errorf("Cannot stat source file %s.", from)
 		return err
 	}
-	defer destination.Close()
 
-	nBytes, err := io.Copy(destination, source)
-	if err != nil {
-		logger.Errorf("Copy file %s failed.", source)
+	if verify {
+		verifier, ok := sink.(sinks.VerifiedPutter)
+		if !ok {
+			// loadConfig rejects verify:true for destinations whose sink
+			// doesn't implement VerifiedPutter, so this should be unreachable
+			// in practice; treat it as a hard error rather than silently
+			// degrading to an unverified Put.
+			return fmt.Errorf("destination does not support verification for %s", name)
+		}
+		if err := verifier.PutVerified(context.Background(), name, source, info.Size()); err != nil {
+			logger.Errorf("Dispatching file %s failed: %s", from, err)
+			return err
+		}
+	} else if err := sink.Put(context.Background(), name, source, info.Size()); err != nil {
+		logger.Errorf("Dispatching file %s failed.", from)
 		return err
 	}
 
-	logger.Infof("Successfully copy file %s with %n bytes", from, nBytes)
+	logger.Infof("Successfully copy file %s with %d bytes", from, info.Size())
 	return nil
 }
 
+// waitStable polls path until its size and mtime stop changing for a full
+// quiet period, so a file is not dispatched while its upstream writer is
+// still appending to it.
+func waitStable(path string, quiet time.Duration) error {
+	var lastSize int64 = -1
+	var lastMod time.Time
+
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Size() == lastSize && info.ModTime().Equal(lastMod) {
+			return nil
+		}
+		lastSize = info.Size()
+		lastMod = info.ModTime()
+		time.Sleep(quiet)
+	}
+}
+
+// job is one file queued for dispatch to a thread's destination.
+type job struct {
+	path     string
+	source   string
+	attempt  int
+	deadline time.Time
+}
+
+const defaultMaxAttempts = 5
+const defaultStabilityPeriod = 500 * time.Millisecond
+
+// backoffSchedule is the retry delay after the Nth failed attempt (0-indexed),
+// capped at its last entry for further attempts.
+var backoffSchedule = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute}
+
+func backoffDelay(attempt int) time.Duration {
+	if attempt >= len(backoffSchedule) {
+		return backoffSchedule[len(backoffSchedule)-1]
+	}
+	return backoffSchedule[attempt]
+}
+
+// deadLetterRecord is the JSON shape written to the deadletter directory for
+// a job that exhausted its retries.
+type deadLetterRecord struct {
+	Path        string    `json:"path"`
+	Destination string    `json:"destination"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	FailedAt    time.Time `json:"failed_at"`
+}
+
+// writeDeadLetter serializes j as JSON into the deadletter directory next to
+// the config file, so an admin tool can inspect or replay it later.
+func (p *program) writeDeadLetter(th thread, j job, dispatchErr error) error {
+	dir := filepath.Join(filepath.Dir(p.confPath), "deadletter")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	record := deadLetterRecord{
+		Path:        j.path,
+		Destination: th.Destination,
+		Attempts:    j.attempt,
+		LastError:   dispatchErr.Error(),
+		FailedAt:    time.Now(),
+	}
+	b, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.json", time.Now().UnixNano(), filepath.Base(j.path))
+	logger.Errorf("Giving up on %s after %d attempts, writing dead-letter record %s.", j.path, j.attempt, name)
+	return os.WriteFile(filepath.Join(dir, name), b, 0644)
+}
+
+// queueFor returns th's job channel, lazily creating it and its worker pool
+// on first use.
+func (p *program) queueFor(th thread) chan job {
+	p.queuesMu.Lock()
+	defer p.queuesMu.Unlock()
+
+	if q, ok := p.queues[th.Source]; ok {
+		return q
+	}
+
+	workers := th.WorkersPerThread
+	if workers <= 0 {
+		workers = 1
+	}
+
+	q := make(chan job, 256)
+	if p.queues == nil {
+		p.queues = make(map[string]chan job)
+	}
+	p.queues[th.Source] = q
+	for i := 0; i < workers; i++ {
+		go p.worker(q)
+	}
+	return q
+}
+
+// push enqueues j onto th's job channel without blocking. If the channel is
+// full (its destination is backed up) the job is dropped and logged rather
+// than blocking the caller, since a blocked push from the single fsnotify
+// event-loop goroutine would stall ingestion for every other thread too. Only
+// the live watcher path should use this: a dropped file is recovered only by a
+// later periodic reconciliation scan (scan_interval), and not at all for a
+// destination that does not support reconciliation. Reconciliation itself
+// must not drop jobs this way or it defeats its own purpose.
+func (p *program) push(th thread, j job) {
+	q := p.queueFor(th)
+	select {
+	case q <- j:
+	default:
+		logger.Errorf("Queue for thread %s is full, dropping job for %s.", th.Source, j.path)
+	}
+}
+
+// pushBlocking enqueues j onto th's job channel, waiting for workers to make
+// room rather than dropping it. Used by reconciliation and retries. Retries
+// and periodic scans run off the fsnotify event-loop goroutine, so blocking
+// there cannot stall event ingestion; the startup scan runs on the run()
+// goroutine before its event loop starts, so while it blocks, events wait in
+// the watcher's channel.
+func (p *program) pushBlocking(th thread, j job) {
+	q := p.queueFor(th)
+	select {
+	case q <- j:
+	case <-p.exit:
+	}
+}
+
+// newJob builds a fresh (attempt 0) job for th, computing its deadline from
+// JobTimeout if configured.
+func (p *program) newJob(th thread, path string) job {
+	j := job{path: path, source: th.Source}
+	if th.JobTimeout != "" {
+		if d, err := time.ParseDuration(th.JobTimeout); err == nil {
+			j.deadline = time.Now().Add(d)
+		} else {
+			logger.Errorf("Invalid job_timeout %q for thread %s: %s", th.JobTimeout, th.Source, err)
+		}
+	}
+	return j
+}
+
+// enqueue queues path as a fresh job for th without blocking the caller; used
+// from the fsnotify event-loop goroutine.
+func (p *program) enqueue(th thread, path string) {
+	p.push(th, p.newJob(th, path))
+}
+
+// enqueueBlocking queues path as a fresh job for th, waiting for room in its
+// queue rather than dropping it; used by reconciliation, whose whole purpose
+// is to recover files that a dropped push would lose all over again.
+func (p *program) enqueueBlocking(th thread, path string) {
+	p.pushBlocking(th, p.newJob(th, path))
+}
+
+// worker consumes jobs from q until it is closed or the program exits.
+func (p *program) worker(q chan job) {
+	for {
+		select {
+		case j, ok := <-q:
+			if !ok {
+				return
+			}
+			p.processJob(j)
+		case <-p.exit:
+			return
+		}
+	}
+}
+
+// processJob waits for j's file to stabilize (only on the first attempt),
+// then dispatches it, retrying with backoff or dead-lettering on failure.
+func (p *program) processJob(j job) {
+	var th thread
+	found := false
+	for _, t := range p.threads() {
+		if t.Source == j.source {
+			th = t
+			found = true
+			break
+		}
+	}
+	if !found {
+		logger.Errorf("Dropping queued file %s: thread for %s is no longer configured.", j.path, j.source)
+		return
+	}
+
+	if j.attempt == 0 {
+		quiet := defaultStabilityPeriod
+		if th.StabilityPeriod != "" {
+			if d, err := time.ParseDuration(th.StabilityPeriod); err == nil {
+				quiet = d
+			} else {
+				logger.Errorf("Invalid stability_period %q for thread %s, using default: %s", th.StabilityPeriod, th.Source, err)
+			}
+		}
+		if err := waitStable(j.path, quiet); err != nil {
+			logger.Errorf("Error waiting for %s to stabilize: %s", j.path, err)
+			return
+		}
+	}
+
+	onExists := onExistsPolicy(th.OnExists)
+	if onExists == "" {
+		onExists = onExistsSkip
+	}
+
+	sink, err := p.sinkFor(th.Destination)
+	if err != nil {
+		logger.Errorf("Cannot resolve destination sink for %s: %s", th.Destination, err)
+		p.retryOrDeadLetter(th, j, err)
+		return
+	}
+
+	if err := dispatch(j.path, sink, th.Verify, onExists); err != nil {
+		logger.Errorf("Failed to dispatch file from %s to %s (attempt %d): %s", j.path, th.Destination, j.attempt+1, err)
+		p.retryOrDeadLetter(th, j, err)
+		return
+	}
+
+	logger.Infof("Success to dispatch file from %s to %s.", j.path, th.Destination)
+}
+
+// retryOrDeadLetter schedules j for another attempt after an exponential
+// backoff, or writes it to the dead-letter directory if its MaxAttempts or
+// JobTimeout has been reached.
+func (p *program) retryOrDeadLetter(th thread, j job, dispatchErr error) {
+	j.attempt++
+	if !j.deadline.IsZero() && !time.Now().Before(j.deadline) {
+		if err := p.writeDeadLetter(th, j, dispatchErr); err != nil {
+			logger.Errorf("Failed to write dead-letter record for %s: %s", j.path, err)
+		}
+		return
+	}
+
+	maxAttempts := th.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if j.attempt >= maxAttempts {
+		if err := p.writeDeadLetter(th, j, dispatchErr); err != nil {
+			logger.Errorf("Failed to write dead-letter record for %s: %s", j.path, err)
+		}
+		return
+	}
+
+	delay := backoffDelay(j.attempt - 1)
+	logger.Warningf("Retrying %s in %s (attempt %d/%d).", j.path, delay, j.attempt+1, maxAttempts)
+	time.AfterFunc(delay, func() {
+		p.pushBlocking(th, j)
+	})
+}
+
 func matchThread(path string, confThreads []thread) int {
 
 	for idx, th := range confThreads {
@@ -157,8 +521,308 @@ var logger service.Logger
 var modeFlags = []string{"run", "install", "uninstall", ""}
 
 type program struct {
-	conf *config
-	exit chan struct{}
+	confPath string
+	confMu   sync.RWMutex
+	conf     *config
+	exit     chan struct{}
+
+	sinkMu sync.Mutex
+	sinks  map[string]sinks.Sink
+
+	queuesMu sync.Mutex
+	queues   map[string]chan job
+}
+
+// sinkFor returns the Sink for a thread's Destination, creating and caching
+// one on first use.
+func (p *program) sinkFor(destination string) (sinks.Sink, error) {
+	p.sinkMu.Lock()
+	defer p.sinkMu.Unlock()
+
+	if s, ok := p.sinks[destination]; ok {
+		return s, nil
+	}
+
+	s, err := sinks.New(destination)
+	if err != nil {
+		return nil, err
+	}
+	if p.sinks == nil {
+		p.sinks = make(map[string]sinks.Sink)
+	}
+	p.sinks[destination] = s
+	return s, nil
+}
+
+// pruneSinks closes and evicts any cached sink whose destination is no
+// longer referenced by threads, so a hot reload that removes a thread or
+// repoints its Destination does not leak the stale sink - notably the
+// live SSH+TCP connection held by an sftpSink - for the life of the
+// process.
+func (p *program) pruneSinks(threads []thread) {
+	live := make(map[string]bool, len(threads))
+	for _, th := range threads {
+		live[th.Destination] = true
+	}
+
+	p.sinkMu.Lock()
+	defer p.sinkMu.Unlock()
+
+	for destination, s := range p.sinks {
+		if live[destination] {
+			continue
+		}
+		if err := s.Close(); err != nil {
+			logger.Errorf("Failed to close stale sink for %s: %s", destination, err)
+		}
+		delete(p.sinks, destination)
+	}
+}
+
+// threads returns a snapshot of the currently active thread mappings. Callers
+// must not mutate the returned slice.
+func (p *program) threads() []thread {
+	p.confMu.RLock()
+	defer p.confMu.RUnlock()
+	return p.conf.Threads
+}
+
+// confSnapshot returns a copy of the current top-level config, for reading
+// settings that only matter once at startup (e.g. the scan options).
+func (p *program) confSnapshot() config {
+	p.confMu.RLock()
+	defer p.confMu.RUnlock()
+	return *p.conf
+}
+
+// fileAlreadyDispatched reports whether the file at from has already reached
+// sink, matched by name and, when sink supports it, by size/mtime and then
+// sha256 digest. The size/mtime check is tried first since it is what most
+// unchanged files need: re-hashing every already-dispatched file on every
+// reconciliation sweep is wasted I/O once a match is already established by
+// the cheaper stat.
+func fileAlreadyDispatched(sink sinks.Sink, from string) (bool, error) {
+	name := filepath.Base(from)
+	exist, err := sink.Exists(name)
+	if err != nil {
+		return false, err
+	}
+	if !exist {
+		return false, nil
+	}
+
+	srcInfo, err := os.Stat(from)
+	if err != nil {
+		return false, err
+	}
+
+	if stater, ok := sink.(sinks.Stater); ok {
+		destSize, destModTime, err := stater.Stat(name)
+		if err != nil {
+			return false, err
+		}
+		if destSize == srcInfo.Size() && !destModTime.Before(srcInfo.ModTime()) {
+			return true, nil
+		}
+	}
+
+	verifier, ok := sink.(sinks.Verifier)
+	if !ok {
+		// With no digest to fall back on, a sink that can stat has already
+		// shown a size/mtime mismatch above; only a name-only sink matches.
+		_, isStater := sink.(sinks.Stater)
+		return !isStater, nil
+	}
+
+	destDigest, err := verifier.SHA256(name)
+	if err != nil {
+		return false, err
+	}
+
+	source, err := os.Open(from)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, source); err != nil {
+		return false, err
+	}
+
+	return destDigest == hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// reconcileThread walks th.Source and dispatches any regular file that is
+// not yet present at th.Destination, catching files that arrived while the
+// service was stopped or events that were dropped by a watcher overflow.
+func (p *program) reconcileThread(th thread) error {
+	sink, err := p.sinkFor(th.Destination)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := sink.(sinks.NotReconcilable); ok {
+		logger.Infof("Destination %s does not support reconciliation, skipping.", th.Destination)
+		return nil
+	}
+
+	return filepath.Walk(th.Source, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		path = filepath.ToSlash(path)
+		present, err := fileAlreadyDispatched(sink, path)
+		if err != nil {
+			logger.Errorf("Error on checking whether %s was already dispatched: %s", path, err)
+			return nil
+		}
+		if present {
+			return nil
+		}
+
+		logger.Infof("Reconciliation found undispatched file: %s, queuing for dispatch.", path)
+		p.enqueueBlocking(th, path)
+		return nil
+	})
+}
+
+// reconcile runs reconcileThread for every configured thread.
+func (p *program) reconcile() {
+	for _, th := range p.threads() {
+		if err := p.reconcileThread(th); err != nil {
+			logger.Errorf("Error scanning source %s for reconciliation: %s", th.Source, err)
+		}
+	}
+}
+
+// periodicScan runs reconcile on a fixed interval until the program exits,
+// catching files lost to watcher overflows on busy filesystems.
+func (p *program) periodicScan(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logger.Infof("Running periodic reconciliation scan.")
+			p.reconcile()
+		case <-p.exit:
+			return
+		}
+	}
+}
+
+// diffThreadSources reports which source directories were added or removed
+// between two thread lists, so the watcher can be updated incrementally.
+func diffThreadSources(oldThreads, newThreads []thread) (added, removed []string) {
+	oldSrc := make(map[string]bool, len(oldThreads))
+	for _, th := range oldThreads {
+		oldSrc[th.Source] = true
+	}
+	newSrc := make(map[string]bool, len(newThreads))
+	for _, th := range newThreads {
+		newSrc[th.Source] = true
+	}
+	for src := range newSrc {
+		if !oldSrc[src] {
+			added = append(added, src)
+		}
+	}
+	for src := range oldSrc {
+		if !newSrc[src] {
+			removed = append(removed, src)
+		}
+	}
+	return added, removed
+}
+
+// reloadConfig re-reads the config file from disk, swaps it in under confMu
+// if it is valid, and incrementally adds/removes watched source directories
+// to match. An invalid config is logged and the previous config is kept.
+func (p *program) reloadConfig(watcher *fsnotify.Watcher) {
+	newConf, err := loadConfig(p.confPath)
+	if err != nil {
+		logger.Errorf("Failed to reload config %s, keeping previous config: %s", p.confPath, err)
+		return
+	}
+
+	p.confMu.Lock()
+	oldThreads := p.conf.Threads
+	p.conf = newConf
+	p.confMu.Unlock()
+
+	p.pruneSinks(newConf.Threads)
+
+	added, removed := diffThreadSources(oldThreads, newConf.Threads)
+	for _, src := range removed {
+		if err := recursiveRemove(src, watcher); err != nil {
+			logger.Errorf("Failed to remove watch on %s: %s", src, err)
+		}
+	}
+	for _, src := range added {
+		if err := recursiveAdd(src, watcher); err != nil {
+			logger.Errorf("Failed to add watch on %s: %s", src, err)
+		}
+	}
+	logger.Infof("Config reloaded from %s.", p.confPath)
+}
+
+// watchConfigFile watches the directory holding the config file and reloads
+// it, debounced by 500ms, whenever it is written. Editors that replace the
+// file (write + rename) still fire through this path since the directory,
+// not the file itself, is watched.
+func (p *program) watchConfigFile(watcher *fsnotify.Watcher) {
+	cfgWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("Error on starting config watcher: %s", err)
+		return
+	}
+	defer cfgWatcher.Close()
+
+	if err := cfgWatcher.Add(filepath.Dir(p.confPath)); err != nil {
+		logger.Errorf("Error on watching config directory: %s", err)
+		return
+	}
+
+	var debounce *time.Timer
+	reload := make(chan struct{}, 1)
+	for {
+		select {
+		case event, ok := <-cfgWatcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(p.confPath) {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			if debounce == nil {
+				debounce = time.AfterFunc(500*time.Millisecond, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				debounce.Reset(500 * time.Millisecond)
+			}
+		case <-reload:
+			p.reloadConfig(watcher)
+		case err, ok := <-cfgWatcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error(err)
+		case <-p.exit:
+			return
+		}
+	}
 }
 
 func (p *program) Start(s service.Service) error {
@@ -182,7 +846,7 @@ func (p *program) run() error {
 	}
 	defer watcher.Close()
 
-	for _, th := range p.conf.Threads {
+	for _, th := range p.threads() {
 		err := recursiveAdd(th.Source, watcher)
 		if err != nil {
 			logger.Errorf("Error on adding new file path %s", th.Source)
@@ -190,6 +854,22 @@ func (p *program) run() error {
 		}
 	}
 
+	go p.watchConfigFile(watcher)
+
+	cfg := p.confSnapshot()
+	if cfg.StartupScan {
+		logger.Infof("Running startup reconciliation scan.")
+		p.reconcile()
+	}
+	if cfg.ScanInterval != "" {
+		interval, err := time.ParseDuration(cfg.ScanInterval)
+		if err != nil {
+			logger.Errorf("Invalid scan_interval %q: %s", cfg.ScanInterval, err)
+		} else {
+			go p.periodicScan(interval)
+		}
+	}
+
 	logger.Infof("Start to listen on specified addresses.")
 	for {
 		select {
@@ -215,20 +895,16 @@ func (p *program) run() error {
 					}
 				} else {
 					logger.Infof("New file created: %s", event.Name)
-					idx := matchThread(event.Name, p.conf.Threads)
+					threads := p.threads()
+					idx := matchThread(event.Name, threads)
 					if idx < 0 {
 						logger.Errorf("New file %s fails to match any source paths specified.", event.Name)
 						continue
 					}
 
-					time.Sleep(500 * time.Millisecond)
-
-					err = copyFile(event.Name, p.conf.Threads[idx].Destination)
-					if err != nil {
-						logger.Errorf("Failed to copy file from %s to %s.", event.Name, p.conf.Threads[idx].Destination)
-						continue
-					}
-					logger.Infof("Success to copy file from %s to %s.", event.Name, p.conf.Threads[idx].Destination)
+					th := threads[idx]
+					logger.Infof("Queuing file %s for dispatch via thread %s.", event.Name, th.Source)
+					p.enqueue(th, event.Name)
 				}
 			}
 
@@ -298,7 +974,7 @@ func main() {
 		Description: "To replace the dispatcher service in common02 server for QMM.",
 	}
 
-	prg := &program{conf: config}
+	prg := &program{confPath: *svcFlag, conf: config}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
 		log.Fatal(err)
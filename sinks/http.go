@@ -0,0 +1,84 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// httpSink POSTs objects as multipart/form-data to a fixed endpoint, parsed
+// from an http(s)://endpoint destination URL. Exists always reports false
+// since there is no generic way to ask an arbitrary endpoint about a prior
+// upload.
+type httpSink struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newHTTPSink(u *url.URL) (Sink, error) {
+	return &httpSink{endpoint: u.String(), client: http.DefaultClient}, nil
+}
+
+// validateHTTPDestination checks a host was given.
+func validateHTTPDestination(u *url.URL) error {
+	if u.Host == "" {
+		return fmt.Errorf("http sink: no host in destination URL")
+	}
+	return nil
+}
+
+func (s *httpSink) Exists(name string) (bool, error) {
+	return false, nil
+}
+
+// notReconcilable marks httpSink as unable to back content-based
+// reconciliation: Exists always reports false, so reconcileThread would
+// otherwise re-POST every file on every scan.
+func (s *httpSink) notReconcilable() {}
+
+// Put streams the multipart body through an io.Pipe rather than buffering it,
+// since QMM sources can be multi-gigabyte files that would otherwise have to
+// be held in memory whole before the request even starts.
+func (s *httpSink) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("http sink: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Close is a no-op: requests are made on the shared default HTTP client,
+// which holds no per-sink connection that needs releasing.
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Sink puts objects into an S3 bucket under an optional key prefix, parsed
+// from an s3://bucket/prefix destination URL. Credentials come from the
+// default AWS credential chain.
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Sink(u *url.URL) (Sink, error) {
+	bucket := u.Host
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 sink: no bucket in destination URL")
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("s3 sink: loading AWS config: %w", err)
+	}
+
+	return &s3Sink{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+// validateS3Destination checks a bucket was given, without loading AWS
+// credentials or constructing a client.
+func validateS3Destination(u *url.URL) error {
+	if u.Host == "" {
+		return fmt.Errorf("s3 sink: no bucket in destination URL")
+	}
+	return nil
+}
+
+func (s *s3Sink) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+func (s *s3Sink) Exists(name string) (bool, error) {
+	_, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *s3Sink) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(s.key(name)),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	return err
+}
+
+// Close is a no-op: the AWS SDK client holds no connection that needs
+// releasing.
+func (s *s3Sink) Close() error {
+	return nil
+}
+
+// Stat returns the named object's size and last-modified time without
+// downloading its content.
+func (s *s3Sink) Stat(name string) (int64, time.Time, error) {
+	out, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var size int64
+	if out.ContentLength != nil {
+		size = *out.ContentLength
+	}
+	var modTime time.Time
+	if out.LastModified != nil {
+		modTime = *out.LastModified
+	}
+	return size, modTime, nil
+}
@@ -0,0 +1,204 @@
+package sinks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/pkg/sftp"
+)
+
+// sftpSink puts objects onto a remote host over SFTP, parsed from an
+// sftp://user@host/path destination URL. Authentication goes through the
+// running ssh-agent and host keys are checked against the user's known_hosts.
+type sftpSink struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	dir    string
+}
+
+func newSFTPSink(u *url.URL) (Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("sftp sink: no host in destination URL")
+	}
+
+	user := "root"
+	if u.User != nil {
+		user = u.User.Username()
+	}
+
+	auth, err := sshAgentAuth()
+	if err != nil {
+		return nil, fmt.Errorf("sftp sink: %w", err)
+	}
+
+	hostKeyCallback, err := knownHostsCallback()
+	if err != nil {
+		return nil, fmt.Errorf("sftp sink: %w", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sftp sink: dialing %s: %w", addr, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sftp sink: starting sftp session: %w", err)
+	}
+
+	return &sftpSink{conn: conn, client: client, dir: u.Path}, nil
+}
+
+func sshAgentAuth() (ssh.AuthMethod, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set, cannot authenticate")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+func knownHostsCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+}
+
+// validateSFTPDestination checks a host was given, without authenticating or
+// dialing out.
+func validateSFTPDestination(u *url.URL) error {
+	if u.Host == "" {
+		return fmt.Errorf("sftp sink: no host in destination URL")
+	}
+	return nil
+}
+
+func (s *sftpSink) Exists(name string) (bool, error) {
+	_, err := s.client.Stat(path.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *sftpSink) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	return s.put(name, r, false)
+}
+
+// PutVerified behaves like Put, but hashes the bytes as they are written and,
+// once the temp file is closed, re-reads it back over SFTP to confirm its
+// digest still matches before renaming it into place. On mismatch the temp
+// file is removed and an error returned, so the final name is never created
+// and a retry sees the object as absent rather than treating a corrupt write
+// as done.
+func (s *sftpSink) PutVerified(ctx context.Context, name string, r io.Reader, size int64) error {
+	return s.put(name, r, true)
+}
+
+func (s *sftpSink) put(name string, r io.Reader, verify bool) error {
+	tmpName := path.Join(s.dir, fmt.Sprintf(".%s.part-%s", name, tempToken()))
+	f, err := s.client.Create(tmpName)
+	if err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(f, io.TeeReader(r, hasher)); err != nil {
+		f.Close()
+		s.client.Remove(tmpName)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		s.client.Remove(tmpName)
+		return err
+	}
+
+	if verify {
+		written := hex.EncodeToString(hasher.Sum(nil))
+		reread, err := s.sha256Path(tmpName)
+		if err != nil {
+			s.client.Remove(tmpName)
+			return err
+		}
+		if reread != written {
+			s.client.Remove(tmpName)
+			return fmt.Errorf("sftp sink: verification failed for %s: wrote sha256 %s, re-read %s", name, written, reread)
+		}
+	}
+
+	if err := s.client.Rename(tmpName, path.Join(s.dir, name)); err != nil {
+		s.client.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// SHA256 re-reads the named object over SFTP and returns its digest, used by
+// reconciliation to compare an already-present object against its source.
+func (s *sftpSink) SHA256(name string) (string, error) {
+	return s.sha256Path(path.Join(s.dir, name))
+}
+
+func (s *sftpSink) sha256Path(remotePath string) (string, error) {
+	f, err := s.client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Stat returns the named object's size and modification time without
+// reading its content.
+func (s *sftpSink) Stat(name string) (int64, time.Time, error) {
+	info, err := s.client.Stat(path.Join(s.dir, name))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+// Close tears down the SFTP session and its underlying SSH connection.
+func (s *sftpSink) Close() error {
+	sftpErr := s.client.Close()
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	return sftpErr
+}
@@ -0,0 +1,167 @@
+// Package sinks provides pluggable destinations for dispatched files. A
+// thread's Destination is parsed as a URL and the scheme selects which
+// implementation in this package handles it.
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sink is a destination that a dispatched file is written to.
+type Sink interface {
+	// Put writes size bytes read from r as an object named name.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Exists reports whether an object named name is already present.
+	Exists(name string) (bool, error)
+	// Close releases any resources (connections, sessions) held by the sink.
+	Close() error
+}
+
+// Verifier is implemented by sinks that can report the digest of a
+// previously-written object, used by reconciliation to compare an
+// already-present object against its source.
+type Verifier interface {
+	Sink
+	SHA256(name string) (string, error)
+}
+
+// VerifiedPutter is implemented by sinks that can verify an object's digest
+// before atomically promoting it to its final name, so a mismatch discards
+// the corrupt write instead of exposing it to consumers first. It backs the
+// per-thread "verify" option. Sinks that publish via a single non-atomic call
+// (s3, http) have no "before promote" point and so don't implement this.
+type VerifiedPutter interface {
+	Sink
+	PutVerified(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// Stater is implemented by sinks that can report an object's size and
+// modification time without reading its full content, used by reconciliation
+// as a cheap pre-check before falling back to a full digest comparison.
+type Stater interface {
+	Sink
+	Stat(name string) (size int64, modTime time.Time, err error)
+}
+
+// NotReconcilable is implemented by sinks whose Exists cannot be trusted to
+// mean "this exact content was already dispatched" (e.g. an http endpoint
+// that accepts a POST without exposing any way to check what it holds).
+// Reconciliation skips sinks that implement it rather than re-dispatching
+// every file on every scan. The unexported method seals it to this package.
+type NotReconcilable interface {
+	Sink
+	notReconcilable()
+}
+
+var tmpTokenCounter uint64
+
+// tempToken returns a token unique to this call, for building sibling
+// temp-file names in Put. A name alone is not enough: the same object can
+// legitimately be in flight on two workers at once (a watcher event racing a
+// reconciliation scan, or a retry racing the job it is replacing), and two
+// concurrent writers sharing one temp path would truncate and then delete
+// each other's data.
+func tempToken() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), atomic.AddUint64(&tmpTokenCounter, 1))
+}
+
+type factory func(u *url.URL) (Sink, error)
+
+var registry = map[string]factory{
+	"file":  newFileSink,
+	"s3":    newS3Sink,
+	"sftp":  newSFTPSink,
+	"http":  newHTTPSink,
+	"https": newHTTPSink,
+}
+
+// New parses destination and returns the Sink registered for its URL scheme.
+// A destination with no "scheme://" prefix is treated as a local path
+// (file://), which also covers Windows paths like "C:\QMM\Outgoing" or
+// "C:/QMM/Outgoing" that url.Parse would otherwise misread as a single-letter
+// scheme "c".
+func New(destination string) (Sink, error) {
+	if !strings.Contains(destination, "://") {
+		return newFileSink(&url.URL{Scheme: "file", Path: destination})
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, fmt.Errorf("parsing destination %q: %w", destination, err)
+	}
+
+	f, ok := registry[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("no sink registered for scheme %q", u.Scheme)
+	}
+	return f(u)
+}
+
+type validator func(u *url.URL) error
+
+var validators = map[string]validator{
+	"file":  validateFileDestination,
+	"s3":    validateS3Destination,
+	"sftp":  validateSFTPDestination,
+	"http":  validateHTTPDestination,
+	"https": validateHTTPDestination,
+}
+
+// Validate parses destination and checks it is well-formed for its scheme
+// without establishing any connection, unlike New which dials out for
+// sinks such as s3:// and sftp://. It is meant for validating config at
+// startup, where a destination that is merely unreachable or not yet
+// authenticated should not stop the service: the first real dispatch or
+// reconciliation attempt establishes the connection through the normal
+// retry/dead-letter path instead.
+func Validate(destination string) error {
+	if !strings.Contains(destination, "://") {
+		return validateFileDestination(&url.URL{Scheme: "file", Path: destination})
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return fmt.Errorf("parsing destination %q: %w", destination, err)
+	}
+
+	v, ok := validators[u.Scheme]
+	if !ok {
+		return fmt.Errorf("no sink registered for scheme %q", u.Scheme)
+	}
+	return v(u)
+}
+
+// verifyCapableSchemes lists the schemes whose sink implements VerifiedPutter.
+// s3 and http/https publish via a single non-atomic call and so have no
+// "before promote" point to verify against.
+var verifyCapableSchemes = map[string]bool{
+	"file": true,
+	"sftp": true,
+}
+
+// ValidateVerify checks that destination's scheme supports the per-thread
+// "verify" option, so a thread requesting verification against a sink that
+// cannot honor it is rejected at config load instead of silently skipping
+// the check at dispatch time.
+func ValidateVerify(destination string) error {
+	scheme := "file"
+	if strings.Contains(destination, "://") {
+		u, err := url.Parse(destination)
+		if err != nil {
+			return fmt.Errorf("parsing destination %q: %w", destination, err)
+		}
+		scheme = u.Scheme
+	}
+
+	if !verifyCapableSchemes[scheme] {
+		return fmt.Errorf("destination scheme %q does not support verify", scheme)
+	}
+	return nil
+}